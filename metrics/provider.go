@@ -0,0 +1,37 @@
+// Package metrics defines the observability seam the rest of this module
+// emits RED (rate/errors/duration) metrics through, so that neither the
+// http client nor the consul watcher needs to depend on Prometheus or
+// OpenTelemetry directly.
+package metrics
+
+// Provider is implemented by whatever metrics backend the application
+// wires in.
+//
+// Histograms fed through ObserveLatency should be registered with buckets
+// that extend well below 1ms (e.g. 0.00025s, 0.0005s, 0.001s, ...) so that
+// fast, same-rack RPCs show up as decimals rather than being bucketed
+// into zero.
+type Provider interface {
+	// IncCounter increments the named counter by one, tagged by labels.
+	IncCounter(name string, labels map[string]string)
+	// SetGauge sets the named gauge to value, tagged by labels.
+	SetGauge(name string, value float64, labels map[string]string)
+	// ObserveLatency records a latency observation in seconds against the
+	// named histogram, tagged by labels.
+	ObserveLatency(name string, seconds float64, labels map[string]string)
+}
+
+var provider Provider
+
+// SetProvider wires p as the Provider used to emit metrics across the
+// module. Passing nil disables metrics emission, which is also the
+// default.
+func SetProvider(p Provider) {
+	provider = p
+}
+
+// Get returns the currently configured Provider, or nil if SetProvider
+// hasn't been called.
+func Get() Provider {
+	return provider
+}
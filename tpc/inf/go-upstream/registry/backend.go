@@ -0,0 +1,28 @@
+package registry
+
+import "context"
+
+// Instance describes a single service instance being registered with a
+// Backend.
+type Instance struct {
+	ID   string   `json:"id"`
+	Addr string   `json:"addr"`
+	Port int      `json:"port"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Backend is implemented by every service discovery mechanism this module
+// knows how to talk to (Consul, etcd, mDNS, an in-memory registry for
+// tests, ...). Watch keeps the chan []*Cluster shape the Consul watch loop
+// has always used, so upstream/loadbalancer code that consumes it is
+// unchanged regardless of which Backend is plugged in.
+type Backend interface {
+	// Register advertises inst under service with the backend.
+	Register(ctx context.Context, service string, inst Instance) error
+	// Deregister removes a previously registered instance from service.
+	Deregister(ctx context.Context, service string, instID string) error
+	// Watch starts watching service and returns a channel that receives
+	// the full, current cluster list every time it changes. The channel
+	// is closed when ctx is canceled.
+	Watch(ctx context.Context, service string) (<-chan []*Cluster, error)
+}
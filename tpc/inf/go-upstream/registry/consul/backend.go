@@ -0,0 +1,55 @@
+package consul
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/lfxnxf/emo-frame/logging"
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+)
+
+// Backend adapts the Consul watch loop to the registry.Backend interface
+// so consumers that shouldn't care about Consul specifically can depend on
+// registry.Backend instead.
+type Backend struct {
+	logger *logging.Logger
+	client *api.Client
+	status []string
+	dc     string
+	filter string
+}
+
+// NewBackend builds a registry.Backend backed by Consul. status, dc and
+// filter are used as the defaults for every Watch call; see Config for
+// their meaning.
+func NewBackend(logger *logging.Logger, client *api.Client, status []string, dc string, filter string) *Backend {
+	return &Backend{logger: logger, client: client, status: status, dc: dc, filter: filter}
+}
+
+// Register is not supported: this module only ever reads service state
+// from Consul, registration is expected to happen out of band (e.g. via
+// the Consul agent or a sidecar).
+func (b *Backend) Register(ctx context.Context, service string, inst registry.Instance) error {
+	return errors.New("consul: Register is not supported, register services via the Consul agent")
+}
+
+// Deregister is not supported for the same reason as Register.
+func (b *Backend) Deregister(ctx context.Context, service string, instID string) error {
+	return errors.New("consul: Deregister is not supported, deregister services via the Consul agent")
+}
+
+// Watch implements registry.Backend by delegating to the package's
+// blocking-query watch loop, which is itself ctx-aware: canceling ctx stops
+// every per-datacenter watchService goroutine Watch started and closes the
+// returned channel, as registry.Backend promises.
+func (b *Backend) Watch(ctx context.Context, service string) (<-chan []*registry.Cluster, error) {
+	config := make(chan []*registry.Cluster)
+	go func() {
+		defer close(config)
+		Watch(ctx, b.logger, b.client, Config{Service: service, Status: b.status, Datacenter: b.dc, Filter: b.filter}, config)
+	}()
+	return config, nil
+}
+
+var _ registry.Backend = (*Backend)(nil)
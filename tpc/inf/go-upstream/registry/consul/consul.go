@@ -0,0 +1,36 @@
+package consul
+
+import (
+	"context"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/lfxnxf/emo-frame/logging"
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+)
+
+// Config describes which Consul service to watch and how to turn its
+// healthy instances into registry.Cluster configuration.
+type Config struct {
+	// Service is the Consul service name to watch.
+	Service string
+	// Status is the set of health check statuses considered passing,
+	// e.g. []string{"passing"}.
+	Status []string
+	// Datacenter is a comma-separated list of datacenters to watch.
+	Datacenter string
+	// Filter is a Consul filter expression (see
+	// https://www.consul.io/api-docs/features/filtering), e.g.
+	// `"connect in ServiceTags and v2 in ServiceTags"`. It is applied
+	// server-side to both the health and catalog queries so that only
+	// matching instances are ever pulled from Consul. Empty means no
+	// filtering.
+	Filter string
+}
+
+// Watch starts watching cfg.Service across cfg.Datacenter and publishes the
+// resulting registry.Cluster list on config every time it changes. It
+// blocks until ctx is canceled, at which point every goroutine it started
+// has also been signaled to stop; it does not wait for them to exit.
+func Watch(ctx context.Context, logger *logging.Logger, client *api.Client, cfg Config, config chan<- []*registry.Cluster) {
+	watchServices(ctx, logger, client, cfg.Service, cfg.Status, cfg.Datacenter, cfg.Filter, config)
+}
@@ -0,0 +1,42 @@
+package consul
+
+import (
+	"github.com/lfxnxf/emo-frame/metrics"
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+)
+
+const (
+	metricEndpointCount  = "consul_watch_endpoint_count"
+	metricClusterChanged = "consul_watch_cluster_changed_total"
+)
+
+// recordEndpointGauges reports the current endpoint count of every
+// cluster in clusters, tagged by cluster name and datacenter.
+func recordEndpointGauges(clusters []*registry.Cluster, dc string) {
+	provider := metrics.Get()
+	if provider == nil {
+		return
+	}
+	for _, cluster := range clusters {
+		provider.SetGauge(metricEndpointCount, float64(len(cluster.Endpoints)), map[string]string{
+			"cluster":    cluster.Name,
+			"datacenter": dc,
+		})
+	}
+}
+
+// recordClusterChanged counts a "cluster changed" event actually fired to
+// the config channel consul.Watch callers read from, i.e. watchServices's
+// aggregate result. It has no per-datacenter label: a per-dc change inside
+// watchService doesn't necessarily cause watchServices to forward a
+// change (or vice versa), so only the aggregation layer's own decision
+// reflects what was truly published downstream.
+func recordClusterChanged(service string) {
+	provider := metrics.Get()
+	if provider == nil {
+		return
+	}
+	provider.IncCounter(metricClusterChanged, map[string]string{
+		"service": service,
+	})
+}
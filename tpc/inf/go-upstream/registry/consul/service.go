@@ -1,6 +1,7 @@
 package consul
 
 import (
+	"context"
 	"reflect"
 	"sort"
 	"strings"
@@ -9,8 +10,12 @@ import (
 	"github.com/hashicorp/consul/api"
 	"github.com/lfxnxf/emo-frame/logging"
 	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+const tracerName = "github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry/consul"
+
 type endpointSlice []registry.Endpoint
 
 func (s endpointSlice) Less(i, j int) bool {
@@ -63,8 +68,10 @@ func checkCheckersEqual(old, new []*api.HealthCheck) bool {
 }
 
 // watchServices monitors the consul health checks and creates a new configuration
-// on every change on all datacenter.
-func watchServices(logger *logging.Logger, client *api.Client, service string, status []string, dc string, config chan<- []*registry.Cluster) {
+// on every change on all datacenter. It returns once ctx is canceled, at
+// which point every per-datacenter watchService goroutine it started has
+// also been signaled to stop.
+func watchServices(ctx context.Context, logger *logging.Logger, client *api.Client, service string, status []string, dc string, filter string, config chan<- []*registry.Cluster) {
 	datacenters := strings.Split(strings.TrimSpace(dc), ",")
 	eventChan := make([]chan []*registry.Cluster, len(datacenters))
 	for i := range eventChan {
@@ -74,14 +81,20 @@ func watchServices(logger *logging.Logger, client *api.Client, service string, s
 	var lastResult []*registry.Cluster
 
 	for i, dc := range datacenters {
-		go watchService(logger, client, service, status, dc, eventChan[i])
+		go watchService(ctx, logger, client, service, status, dc, filter, eventChan[i])
 	}
-	cases := make([]reflect.SelectCase, len(datacenters))
+	cases := make([]reflect.SelectCase, len(datacenters)+1)
 	for i, ch := range eventChan {
 		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
 	}
+	doneCase := len(datacenters)
+	cases[doneCase] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+
 	for {
 		chosen, value, ok := reflect.Select(cases)
+		if chosen == doneCase {
+			return
+		}
 		if !ok {
 			cases[chosen].Chan = reflect.ValueOf(nil)
 			continue
@@ -99,7 +112,10 @@ func watchServices(logger *logging.Logger, client *api.Client, service string, s
 			}
 		}
 		if checkClusterChanged(result, lastResult) {
-			config <- result
+			recordClusterChanged(service)
+			if !registry.TrySend(ctx, config, result) {
+				return
+			}
 		} else {
 			logger.Infof("consul: Service %s Datacenter %s Health changed but server list not changed", service, dc)
 		}
@@ -108,20 +124,36 @@ func watchServices(logger *logging.Logger, client *api.Client, service string, s
 }
 
 // watchService monitors the consul health checks and creates a new configuration
-// on every change.
-func watchService(logger *logging.Logger, client *api.Client, service string, status []string, dc string, config chan<- []*registry.Cluster) {
+// on every change. filter is a Consul filter expression (see
+// https://www.consul.io/api-docs/features/filtering) that is passed through to
+// every health and catalog query so that only matching instances are ever
+// pulled from Consul; an empty filter behaves as before. watchService
+// returns once ctx is canceled.
+func watchService(ctx context.Context, logger *logging.Logger, client *api.Client, service string, status []string, dc string, filter string, config chan<- []*registry.Cluster) {
 	var lastIndex uint64
 	var oldCheckers []*api.HealthCheck
 	var lastConfig []*registry.Cluster
 
 	for {
-		q := &api.QueryOptions{RequireConsistent: true, WaitIndex: lastIndex}
+		if ctx.Err() != nil {
+			return
+		}
+
+		q := &api.QueryOptions{RequireConsistent: true, WaitIndex: lastIndex, Filter: filter}
 		q.Datacenter = dc
-		services, meta, err := client.Health().Service(service, "", false, q)
+
+		queryCtx, span := otel.Tracer(tracerName).Start(ctx, "consul.watchService.blockingQuery")
+		span.SetAttributes(attribute.String("consul.service", service), attribute.String("consul.datacenter", dc))
+		services, meta, err := client.Health().Service(service, "", false, q.WithContext(queryCtx))
+		span.End()
 		// (service, q)
 		if err != nil {
 			logger.Warnf("consul: Error fetching health state. %v", err)
-			time.Sleep(time.Second)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
 			continue
 		}
 		checks := make([]*api.HealthCheck, 0)
@@ -137,9 +169,15 @@ func watchService(logger *logging.Logger, client *api.Client, service string, st
 			continue
 		}
 		oldCheckers = passCheckers
-		newConfig := servicesConfig(logger, client, passCheckers, dc)
+		newConfig := servicesConfig(logger, client, passCheckers, dc, filter)
+		// newConfig is built from the filtered health and catalog results,
+		// so checkClusterChanged sees a change in which instances match
+		// filter as a cluster change and it is forwarded on config.
 		if checkClusterChanged(newConfig, lastConfig) {
-			config <- newConfig
+			recordEndpointGauges(newConfig, dc)
+			if !registry.TrySend(ctx, config, newConfig) {
+				return
+			}
 		} else {
 			logger.Infof("consul: Service %s Datacenter %s Health changed to #%d, but server list not changed", service, dc, meta.LastIndex)
 		}
@@ -149,7 +187,7 @@ func watchService(logger *logging.Logger, client *api.Client, service string, st
 
 // servicesConfig determines which service instances have passing health checks
 // and then finds the ones which have tags with the right prefix to build the config from.
-func servicesConfig(logger *logging.Logger, client *api.Client, checks []*api.HealthCheck, dc string) []*registry.Cluster {
+func servicesConfig(logger *logging.Logger, client *api.Client, checks []*api.HealthCheck, dc string, filter string) []*registry.Cluster {
 	// map service name to list of service passing for which the health check is ok
 	m := map[string]map[string]bool{}
 	for _, check := range checks {
@@ -163,7 +201,7 @@ func servicesConfig(logger *logging.Logger, client *api.Client, checks []*api.He
 
 	var clusters []*registry.Cluster
 	for name, passing := range m {
-		cluster := serviceConfig(logger, client, name, passing, dc)
+		cluster := serviceConfig(logger, client, name, passing, dc, filter)
 		clusters = append(clusters, cluster)
 	}
 
@@ -171,7 +209,7 @@ func servicesConfig(logger *logging.Logger, client *api.Client, checks []*api.He
 }
 
 // serviceConfig constructs the config for all good instances of a single service.
-func serviceConfig(logger *logging.Logger, client *api.Client, name string, passing map[string]bool, dc string) (cluster *registry.Cluster) {
+func serviceConfig(logger *logging.Logger, client *api.Client, name string, passing map[string]bool, dc string, filter string) (cluster *registry.Cluster) {
 	cluster = &registry.Cluster{
 		Name:      name,
 		Endpoints: []registry.Endpoint{},
@@ -180,7 +218,7 @@ func serviceConfig(logger *logging.Logger, client *api.Client, name string, pass
 		return
 	}
 
-	q := &api.QueryOptions{RequireConsistent: true}
+	q := &api.QueryOptions{RequireConsistent: true, Filter: filter}
 	q.Datacenter = dc
 	svcs, _, err := client.Catalog().Service(name, "", q)
 	if err != nil {
@@ -0,0 +1,138 @@
+// Package etcd provides a registry.Backend backed by etcd's key-value
+// store and watch API, for deployments (e.g. Kubernetes) that run etcd
+// instead of Consul.
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/lfxnxf/emo-frame/logging"
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+)
+
+// Backend stores instances under <prefix>/<service>/<instance id> as a
+// JSON encoded registry.Instance.
+type Backend struct {
+	logger *logging.Logger
+	client *clientv3.Client
+	prefix string
+}
+
+// NewBackend returns an etcd-backed registry.Backend. prefix namespaces
+// all keys this backend reads and writes, e.g. "/emo-frame/services".
+func NewBackend(logger *logging.Logger, client *clientv3.Client, prefix string) *Backend {
+	return &Backend{logger: logger, client: client, prefix: prefix}
+}
+
+func (b *Backend) key(service, instID string) string {
+	return fmt.Sprintf("%s/%s/%s", b.prefix, service, instID)
+}
+
+func (b *Backend) Register(ctx context.Context, service string, inst registry.Instance) error {
+	value, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.Put(ctx, b.key(service, inst.ID), string(value))
+	return err
+}
+
+func (b *Backend) Deregister(ctx context.Context, service string, instID string) error {
+	_, err := b.client.Delete(ctx, b.key(service, instID))
+	return err
+}
+
+// Watch returns the current instances for service and keeps the returned
+// channel up to date by watching the etcd prefix from the revision the
+// initial read was served at, so no updates are missed in between.
+func (b *Backend) Watch(ctx context.Context, service string) (<-chan []*registry.Cluster, error) {
+	servicePrefix := fmt.Sprintf("%s/%s/", b.prefix, service)
+
+	resp, err := b.client.Get(ctx, servicePrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &registry.Cluster{Name: service}
+	for _, kv := range resp.Kvs {
+		var inst registry.Instance
+		if err := json.Unmarshal(kv.Value, &inst); err != nil {
+			b.logger.Warnf("etcd: Error decoding instance at %s. %v", kv.Key, err)
+			continue
+		}
+		cluster.Endpoints = append(cluster.Endpoints, registry.Endpoint{ID: inst.ID, Addr: inst.Addr, Port: inst.Port, Tags: inst.Tags})
+	}
+
+	config := make(chan []*registry.Cluster)
+	var mu sync.Mutex
+
+	go func() {
+		defer close(config)
+
+		if !registry.TrySend(ctx, config, snapshot(cluster, &mu)) {
+			return
+		}
+
+		watchChan := b.client.Watch(ctx, servicePrefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+		for wresp := range watchChan {
+			if err := wresp.Err(); err != nil {
+				b.logger.Warnf("etcd: Error watching %s. %v", servicePrefix, err)
+				continue
+			}
+			mu.Lock()
+			for _, ev := range wresp.Events {
+				id := string(ev.Kv.Key[len(servicePrefix):])
+				if ev.Type == clientv3.EventTypeDelete {
+					removeEndpoint(cluster, id)
+					continue
+				}
+				var inst registry.Instance
+				if err := json.Unmarshal(ev.Kv.Value, &inst); err != nil {
+					b.logger.Warnf("etcd: Error decoding instance at %s. %v", ev.Kv.Key, err)
+					continue
+				}
+				upsertEndpoint(cluster, registry.Endpoint{ID: inst.ID, Addr: inst.Addr, Port: inst.Port, Tags: inst.Tags})
+			}
+			mu.Unlock()
+			if !registry.TrySend(ctx, config, snapshot(cluster, &mu)) {
+				return
+			}
+		}
+	}()
+
+	return config, nil
+}
+
+func snapshot(cluster *registry.Cluster, mu *sync.Mutex) []*registry.Cluster {
+	mu.Lock()
+	defer mu.Unlock()
+	endpoints := make([]registry.Endpoint, len(cluster.Endpoints))
+	copy(endpoints, cluster.Endpoints)
+	return []*registry.Cluster{{Name: cluster.Name, Endpoints: endpoints}}
+}
+
+func upsertEndpoint(cluster *registry.Cluster, e registry.Endpoint) {
+	for i, existing := range cluster.Endpoints {
+		if existing.ID == e.ID {
+			cluster.Endpoints[i] = e
+			return
+		}
+	}
+	cluster.Endpoints = append(cluster.Endpoints, e)
+}
+
+func removeEndpoint(cluster *registry.Cluster, id string) {
+	for i, existing := range cluster.Endpoints {
+		if existing.ID == id {
+			cluster.Endpoints = append(cluster.Endpoints[:i], cluster.Endpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+var _ registry.Backend = (*Backend)(nil)
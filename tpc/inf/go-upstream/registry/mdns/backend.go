@@ -0,0 +1,135 @@
+// Package mdns provides a registry.Backend built on mDNS/DNS-SD, for local
+// development setups that don't run Consul or etcd.
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/mdns"
+
+	"github.com/lfxnxf/emo-frame/logging"
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+)
+
+const defaultPollInterval = 5 * time.Second
+
+// Backend advertises instances via an mDNS responder and discovers them by
+// browsing the local network.
+type Backend struct {
+	logger       *logging.Logger
+	pollInterval time.Duration
+
+	mu      sync.Mutex
+	servers map[string]*mdns.Server
+}
+
+// NewBackend returns an mDNS-backed registry.Backend. pollInterval
+// controls how often Watch re-browses the network for instances; zero
+// means defaultPollInterval.
+func NewBackend(logger *logging.Logger, pollInterval time.Duration) *Backend {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	return &Backend{logger: logger, pollInterval: pollInterval, servers: map[string]*mdns.Server{}}
+}
+
+func serviceType(service string) string {
+	return fmt.Sprintf("_%s._tcp", service)
+}
+
+func (b *Backend) Register(ctx context.Context, service string, inst registry.Instance) error {
+	zone, err := mdns.NewMDNSService(inst.ID, serviceType(service), "", "", inst.Port, nil, []string{strings.Join(inst.Tags, ",")})
+	if err != nil {
+		return err
+	}
+	server, err := mdns.NewServer(&mdns.Config{Zone: zone})
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.servers[service+"/"+inst.ID] = server
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Backend) Deregister(ctx context.Context, service string, instID string) error {
+	key := service + "/" + instID
+	b.mu.Lock()
+	server, ok := b.servers[key]
+	delete(b.servers, key)
+	b.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return server.Shutdown()
+}
+
+// Watch polls the network every pollInterval and publishes the cluster
+// whenever the set of discovered instances changes.
+func (b *Backend) Watch(ctx context.Context, service string) (<-chan []*registry.Cluster, error) {
+	config := make(chan []*registry.Cluster)
+
+	go func() {
+		defer close(config)
+		ticker := time.NewTicker(b.pollInterval)
+		defer ticker.Stop()
+
+		var last []registry.Endpoint
+		sent := false
+		for {
+			cluster := b.browse(service)
+			endpoints := cluster[0].Endpoints
+			sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].ID < endpoints[j].ID })
+			if !sent || !reflect.DeepEqual(endpoints, last) {
+				if !registry.TrySend(ctx, config, cluster) {
+					return
+				}
+				last, sent = endpoints, true
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return config, nil
+}
+
+func (b *Backend) browse(service string) []*registry.Cluster {
+	entries := make(chan *mdns.ServiceEntry, 16)
+	cluster := &registry.Cluster{Name: service}
+
+	done := make(chan struct{})
+	go func() {
+		for e := range entries {
+			cluster.Endpoints = append(cluster.Endpoints, registry.Endpoint{
+				ID:   e.Name,
+				Addr: e.AddrV4.String(),
+				Port: e.Port,
+				Tags: strings.Split(strings.Join(e.InfoFields, ","), ","),
+			})
+		}
+		close(done)
+	}()
+
+	if err := mdns.Query(&mdns.QueryParam{Service: serviceType(service), Entries: entries, Timeout: time.Second}); err != nil {
+		b.logger.Warnf("mdns: Error browsing service %s. %v", service, err)
+	}
+	close(entries)
+	<-done
+
+	return []*registry.Cluster{cluster}
+}
+
+var _ registry.Backend = (*Backend)(nil)
@@ -0,0 +1,121 @@
+// Package memory provides an in-memory registry.Backend, primarily useful
+// for unit tests that exercise upstream/loadbalancer code without standing
+// up a real Consul agent or etcd cluster.
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+)
+
+// Backend is an in-memory registry.Backend. The zero value is not usable;
+// construct one with NewBackend.
+type Backend struct {
+	mu       sync.Mutex
+	clusters map[string]*registry.Cluster
+	watchers map[string][]chan []*registry.Cluster
+}
+
+// NewBackend returns an empty in-memory backend.
+func NewBackend() *Backend {
+	return &Backend{
+		clusters: map[string]*registry.Cluster{},
+		watchers: map[string][]chan []*registry.Cluster{},
+	}
+}
+
+func (b *Backend) Register(ctx context.Context, service string, inst registry.Instance) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cluster := b.clusterLocked(service)
+	endpoint := registry.Endpoint{ID: inst.ID, Addr: inst.Addr, Port: inst.Port, Tags: inst.Tags}
+	for i, e := range cluster.Endpoints {
+		if e.ID == inst.ID {
+			cluster.Endpoints[i] = endpoint
+			b.notifyLocked(service)
+			return nil
+		}
+	}
+	cluster.Endpoints = append(cluster.Endpoints, endpoint)
+	b.notifyLocked(service)
+	return nil
+}
+
+func (b *Backend) Deregister(ctx context.Context, service string, instID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cluster := b.clusterLocked(service)
+	for i, e := range cluster.Endpoints {
+		if e.ID == instID {
+			cluster.Endpoints = append(cluster.Endpoints[:i], cluster.Endpoints[i+1:]...)
+			break
+		}
+	}
+	b.notifyLocked(service)
+	return nil
+}
+
+func (b *Backend) Watch(ctx context.Context, service string) (<-chan []*registry.Cluster, error) {
+	b.mu.Lock()
+	ch := make(chan []*registry.Cluster, 1)
+	b.watchers[service] = append(b.watchers[service], ch)
+	ch <- cloneCluster(b.clusterLocked(service))
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.removeWatcherLocked(service, ch)
+	}()
+
+	return ch, nil
+}
+
+// clusterLocked returns the cluster for service, creating an empty one if
+// it doesn't exist yet. b.mu must be held.
+func (b *Backend) clusterLocked(service string) *registry.Cluster {
+	cluster, ok := b.clusters[service]
+	if !ok {
+		cluster = &registry.Cluster{Name: service}
+		b.clusters[service] = cluster
+	}
+	return cluster
+}
+
+func (b *Backend) notifyLocked(service string) {
+	snapshot := cloneCluster(b.clusterLocked(service))
+	for _, ch := range b.watchers[service] {
+		// Replace a snapshot the watcher hasn't read yet instead of dropping
+		// the new one, so the channel always ends on the current state. Only
+		// holders of b.mu send on ch, so after the drain the send can't block.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- snapshot
+	}
+}
+
+func (b *Backend) removeWatcherLocked(service string, target chan []*registry.Cluster) {
+	watchers := b.watchers[service]
+	for i, ch := range watchers {
+		if ch == target {
+			b.watchers[service] = append(watchers[:i], watchers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+func cloneCluster(cluster *registry.Cluster) []*registry.Cluster {
+	endpoints := make([]registry.Endpoint, len(cluster.Endpoints))
+	copy(endpoints, cluster.Endpoints)
+	return []*registry.Cluster{{Name: cluster.Name, Endpoints: endpoints}}
+}
+
+var _ registry.Backend = (*Backend)(nil)
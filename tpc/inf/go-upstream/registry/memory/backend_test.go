@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+)
+
+func TestBackend_RegisterWatchDeregister(t *testing.T) {
+	b := NewBackend()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := b.Watch(ctx, "user-svc")
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	initial := <-ch
+	if len(initial) != 1 || len(initial[0].Endpoints) != 0 {
+		t.Fatalf("expected one empty cluster, got %+v", initial)
+	}
+
+	if err := b.Register(ctx, "user-svc", registry.Instance{ID: "1", Addr: "10.0.0.1", Port: 8080}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	select {
+	case clusters := <-ch:
+		if len(clusters[0].Endpoints) != 1 || clusters[0].Endpoints[0].ID != "1" {
+			t.Fatalf("expected endpoint 1 after Register, got %+v", clusters)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Register update")
+	}
+
+	if err := b.Deregister(ctx, "user-svc", "1"); err != nil {
+		t.Fatalf("Deregister: %v", err)
+	}
+
+	select {
+	case clusters := <-ch:
+		if len(clusters[0].Endpoints) != 0 {
+			t.Fatalf("expected no endpoints after Deregister, got %+v", clusters)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Deregister update")
+	}
+}
+
+func TestBackend_WatchClosesChannelOnCancel(t *testing.T) {
+	b := NewBackend()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch, err := b.Watch(ctx, "user-svc")
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	<-ch // drain the initial snapshot
+
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("expected channel to be closed after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for channel to close")
+	}
+}
+
+func TestBackend_RegisterUpdatesExistingInstance(t *testing.T) {
+	b := NewBackend()
+	ctx := context.Background()
+
+	if err := b.Register(ctx, "user-svc", registry.Instance{ID: "1", Addr: "10.0.0.1", Port: 8080}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := b.Register(ctx, "user-svc", registry.Instance{ID: "1", Addr: "10.0.0.2", Port: 9090}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	ch, err := b.Watch(ctx, "user-svc")
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	clusters := <-ch
+	if len(clusters[0].Endpoints) != 1 || clusters[0].Endpoints[0].Addr != "10.0.0.2" {
+		t.Fatalf("expected a single updated endpoint, got %+v", clusters[0].Endpoints)
+	}
+}
@@ -0,0 +1,16 @@
+package registry
+
+import "context"
+
+// TrySend delivers v on ch, but gives up and reports false if ctx is
+// canceled first so a stalled receiver can't leak the sending goroutine
+// forever. The consul, etcd and mDNS backends' Watch loops use this to
+// publish cluster updates.
+func TrySend(ctx context.Context, ch chan<- []*Cluster, v []*Cluster) bool {
+	select {
+	case ch <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+)
+
+// ErrNoEndpoints is returned by a Balancer when the cluster it was given
+// has no endpoints to pick from.
+var ErrNoEndpoints = errors.New("client: no endpoints available")
+
+// Balancer picks one endpoint out of an upstream's current endpoints for a
+// single request.
+type Balancer interface {
+	Pick(endpoints []registry.Endpoint) (registry.Endpoint, error)
+}
+
+type roundRobinBalancer struct {
+	next uint64
+}
+
+// NewRoundRobinBalancer returns a Balancer that cycles through endpoints
+// in order.
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{}
+}
+
+func (b *roundRobinBalancer) Pick(endpoints []registry.Endpoint) (registry.Endpoint, error) {
+	if len(endpoints) == 0 {
+		return registry.Endpoint{}, ErrNoEndpoints
+	}
+	i := atomic.AddUint64(&b.next, 1) - 1
+	return endpoints[int(i)%len(endpoints)], nil
+}
+
+type randomBalancer struct{}
+
+// NewRandomBalancer returns a Balancer that picks a uniformly random
+// endpoint on every call.
+func NewRandomBalancer() Balancer {
+	return randomBalancer{}
+}
+
+func (randomBalancer) Pick(endpoints []registry.Endpoint) (registry.Endpoint, error) {
+	if len(endpoints) == 0 {
+		return registry.Endpoint{}, ErrNoEndpoints
+	}
+	return endpoints[rand.Intn(len(endpoints))], nil
+}
+
+type weightedBalancer struct{}
+
+// NewWeightedBalancer returns a Balancer that weights endpoints by a
+// "weight=<n>" tag (see registry.Endpoint.Tags): an endpoint tagged
+// "weight=3" is three times as likely to be picked as an untagged one.
+func NewWeightedBalancer() Balancer {
+	return weightedBalancer{}
+}
+
+func (weightedBalancer) Pick(endpoints []registry.Endpoint) (registry.Endpoint, error) {
+	if len(endpoints) == 0 {
+		return registry.Endpoint{}, ErrNoEndpoints
+	}
+
+	weights := make([]int, len(endpoints))
+	total := 0
+	for i, e := range endpoints {
+		weights[i] = endpointWeight(e)
+		total += weights[i]
+	}
+
+	pick := rand.Intn(total)
+	for i, w := range weights {
+		if pick < w {
+			return endpoints[i], nil
+		}
+		pick -= w
+	}
+	return endpoints[len(endpoints)-1], nil
+}
+
+const weightTagPrefix = "weight="
+
+func endpointWeight(e registry.Endpoint) int {
+	for _, tag := range e.Tags {
+		if !strings.HasPrefix(tag, weightTagPrefix) {
+			continue
+		}
+		if w, err := strconv.Atoi(tag[len(weightTagPrefix):]); err == nil && w > 0 {
+			return w
+		}
+	}
+	return 1
+}
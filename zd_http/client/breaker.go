@@ -0,0 +1,153 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// BreakerConfig configures the per-host circuit breaker installed by
+// WithBreaker.
+type BreakerConfig struct {
+	// Window is the length of the window over which the failure ratio is
+	// computed. The window is fixed, not sliding: its counts are cleared
+	// by the first request recorded more than Window after it began.
+	Window time.Duration
+	// MinRequests is the minimum number of requests within Window before
+	// the breaker will consider tripping.
+	MinRequests int
+	// FailureRatio trips the breaker open once reached or exceeded.
+	FailureRatio float64
+	// OpenTimeout is how long the breaker stays open before letting a
+	// single half-open probe request through.
+	OpenTimeout time.Duration
+}
+
+// DefaultBreakerConfig is a reasonable starting point for WithBreaker.
+var DefaultBreakerConfig = BreakerConfig{
+	Window:       10 * time.Second,
+	MinRequests:  20,
+	FailureRatio: 0.5,
+	OpenTimeout:  5 * time.Second,
+}
+
+// breaker is a per-host circuit breaker with a closed/open/half-open state
+// machine driven by the failure ratio within the current Window. While
+// half-open, probing
+// gates admission to a single in-flight request so a burst of concurrent
+// callers can't all land on the upstream at once and re-trip it.
+type breaker struct {
+	cfg BreakerConfig
+
+	mu        sync.Mutex
+	state     breakerState
+	probing   bool
+	openUntil time.Time
+	bucket    time.Time
+	total     int
+	failures  int
+}
+
+// breakerKey identifies a cached breaker. Including cfg means a
+// WithBreaker call with different settings for the same host gets its own
+// breaker instead of being silently ignored by whichever call reached the
+// host first.
+type breakerKey struct {
+	host string
+	cfg  BreakerConfig
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[breakerKey]*breaker{}
+)
+
+// breakerFor returns the shared breaker for (host, cfg), creating one if
+// it doesn't exist yet.
+func breakerFor(host string, cfg BreakerConfig) *breaker {
+	key := breakerKey{host: host, cfg: cfg}
+
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[key]
+	if !ok {
+		b = &breaker{cfg: cfg, bucket: time.Now()}
+		breakers[key] = b
+	}
+	return b
+}
+
+// allow reports whether a request to this host may proceed. It
+// transitions open -> half-open once cfg.OpenTimeout has elapsed, and
+// while half-open lets through only one probe request at a time.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if now.Before(b.openUntil) {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record reports the outcome of a request that a prior allow() let
+// through.
+func (b *breaker) record(now time.Time, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		if success {
+			b.resetLocked(now)
+		} else {
+			b.tripLocked(now)
+		}
+		return
+	}
+
+	if now.Sub(b.bucket) > b.cfg.Window {
+		b.bucket = now
+		b.total = 0
+		b.failures = 0
+	}
+	b.total++
+	if !success {
+		b.failures++
+	}
+	if b.total >= b.cfg.MinRequests && float64(b.failures)/float64(b.total) >= b.cfg.FailureRatio {
+		b.tripLocked(now)
+	}
+}
+
+func (b *breaker) tripLocked(now time.Time) {
+	b.state = breakerOpen
+	b.openUntil = now.Add(b.cfg.OpenTimeout)
+}
+
+func (b *breaker) resetLocked(now time.Time) {
+	b.state = breakerClosed
+	b.bucket = now
+	b.total = 0
+	b.failures = 0
+}
@@ -4,16 +4,18 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
-	"errors"
 	"fmt"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/lfxnxf/emo-frame/logging"
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
-	"strings"
+	neturl "net/url"
+	"sync"
 	"time"
 )
 
@@ -25,12 +27,18 @@ type client struct {
 	ctx             context.Context
 	url             string
 	header          http.Header
-	body            io.Reader
+	bodyBytes       []byte
 	method          string
 	timeout         int64
 	err             error
 	respBody        *http.Response
 	tlsClientConfig *tls.Config
+
+	upstream   string
+	balancer   Balancer
+	retry      *RetryConfig
+	idempotent bool
+	breakerCfg *BreakerConfig
 }
 
 func NewReq(ctx context.Context) *client {
@@ -87,6 +95,23 @@ func (c *client) WithTimeout(timeout int64) *client {
 }
 
 func (c *client) WithBody(body interface{}) *client {
+	defer recoverPanic(&c.err)
+	// A panicking Reader is recovered here rather than by the defer above:
+	// WithBody's result is unnamed, so a panic that unwinds out of it would
+	// leave the caller holding a nil *client.
+	if r, ok := body.(io.Reader); ok {
+		var buf []byte
+		var err error
+		func() {
+			defer recoverPanic(&err)
+			buf, err = ioutil.ReadAll(r)
+		}()
+		if err != nil {
+			c.err = err
+			return c
+		}
+		body = buf
+	}
 	switch v := body.(type) {
 	case io.Reader:
 		buf, err := ioutil.ReadAll(v)
@@ -94,48 +119,124 @@ func (c *client) WithBody(body interface{}) *client {
 			c.err = err
 			return c
 		}
-		c.body = bytes.NewReader(buf)
+		c.bodyBytes = buf
 	case []byte:
-		c.body = bytes.NewReader(v)
+		c.bodyBytes = v
 	case string:
-		c.body = strings.NewReader(v)
+		c.bodyBytes = []byte(v)
 	default:
 		buf, err := jsoniter.Marshal(body)
 		if err != nil {
 			c.err = err
 			return c
 		}
-		c.body = bytes.NewReader(buf)
+		c.bodyBytes = buf
 	}
 	return c
 }
 
+// Upstream resolves url against the named upstream's current endpoints
+// (via the Resolver configured with SetUpstreamResolver) instead of
+// dialing url's host directly, e.g.
+// NewReq(ctx).Upstream("user-svc").Get("/v1/x").Response().
+func (c *client) Upstream(name string) *client {
+	c.upstream = name
+	return c
+}
+
+// WithBalancer selects how Upstream picks an endpoint out of the
+// resolved cluster. The default is round-robin.
+func (c *client) WithBalancer(b Balancer) *client {
+	c.balancer = b
+	return c
+}
+
+// WithRetry retries the request up to n additional times using
+// DefaultRetryConfig's backoff. Only GET/HEAD/OPTIONS requests are
+// retried unless WithIdempotent is also set.
+func (c *client) WithRetry(n int) *client {
+	cfg := DefaultRetryConfig
+	cfg.MaxRetries = n
+	c.retry = &cfg
+	return c
+}
+
+// WithRetryConfig is like WithRetry but gives full control over the
+// backoff.
+func (c *client) WithRetryConfig(cfg RetryConfig) *client {
+	c.retry = &cfg
+	return c
+}
+
+// WithIdempotent marks a non-GET/HEAD/OPTIONS request (e.g. an idempotent
+// PUT) as safe for WithRetry to retry.
+func (c *client) WithIdempotent() *client {
+	c.idempotent = true
+	return c
+}
+
+// WithBreaker enables a per-host circuit breaker using cfg. Once the
+// failure ratio for a host within the current cfg.Window reaches
+// cfg.FailureRatio, further
+// requests to that host fail fast until cfg.OpenTimeout elapses.
+func (c *client) WithBreaker(cfg BreakerConfig) *client {
+	c.breakerCfg = &cfg
+	return c
+}
+
 type option func(c *client)
 
-func (c *client) Response() *client {
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: c.tlsClientConfig,
-			DialContext: (&net.Dialer{
-				Timeout:   time.Duration(c.timeout) * time.Second,
-				KeepAlive: time.Second * 5,
-			}).DialContext,
-			IdleConnTimeout:     time.Second * 5,
-			MaxIdleConnsPerHost: 10,
-		},
-		Timeout: time.Duration(c.timeout) * time.Second,
+func (c *client) Response() (result *client) {
+	result = c
+	defer recoverPanic(&c.err)
+
+	if c.err != nil {
+		return c
 	}
 
-	if c.method == http.MethodGet {
-		c.body = nil
+	url := c.url
+	if c.upstream != "" {
+		endpoint, err := c.pickEndpoint()
+		if err != nil {
+			c.err = err
+			return c
+		}
+		url = fmt.Sprintf("http://%s:%d%s", endpoint.Addr, endpoint.Port, c.url)
 	}
-	req, err := http.NewRequest(c.method, c.url, c.body)
-	if err != nil {
-		c.err = err
-		return c
+
+	host := requestHost(url)
+	maxRetries := 0
+	if c.retry != nil {
+		maxRetries = c.retry.MaxRetries
 	}
-	req.Header = c.header
-	resp, err := client.Do(req)
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		var br *breaker
+		if c.breakerCfg != nil {
+			br = breakerFor(host, *c.breakerCfg)
+			if !br.allow(time.Now()) {
+				err = fmt.Errorf("client: circuit breaker open for host %s", host)
+				break
+			}
+		}
+
+		resp, err = c.doRecoverPanic(url)
+
+		if br != nil {
+			br.record(time.Now(), err == nil)
+		}
+
+		if err == nil || attempt == maxRetries || !(c.idempotent || isRetryable(c.method)) {
+			break
+		}
+		if !c.sleepBackoff(retryBackoff(*c.retry, attempt)) {
+			err = c.ctx.Err()
+			break
+		}
+	}
+
 	if err != nil {
 		c.err = err
 		return c
@@ -144,6 +245,96 @@ func (c *client) Response() *client {
 	return c
 }
 
+// doRecoverPanic runs c.do(url) for a single retry attempt, converting a
+// panic (e.g. from a flaky custom RoundTripper) into a *PanicError instead
+// of letting it unwind the whole retry loop, so the breaker still learns
+// about the failed attempt via br.record and any remaining retries still
+// run.
+func (c *client) doRecoverPanic(url string) (resp *http.Response, err error) {
+	defer recoverPanic(&err)
+	return c.do(url)
+}
+
+// sleepBackoff waits for d, but returns early with false if c.ctx is
+// canceled first so a canceled context doesn't block the retry loop for up
+// to d.
+func (c *client) sleepBackoff(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+func (c *client) do(url string) (*http.Response, error) {
+	start := time.Now()
+	ctx, span := startSpan(c.ctx, c.method, url)
+	defer span.End()
+
+	httpClient := clientFor(time.Duration(c.timeout)*time.Second, c.tlsClientConfig)
+
+	var body io.Reader
+	if c.method != http.MethodGet && c.bodyBytes != nil {
+		body = bytes.NewReader(c.bodyBytes)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, url, body)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	req.Header = c.header
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	injectTraceContext(ctx, req.Header)
+
+	resp, err := httpClient.Do(req)
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		err = &TimeoutError{Err: err}
+	}
+
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	span.SetAttributes(attribute.Int("http.status_code", statusCode))
+	if err != nil {
+		span.RecordError(err)
+	}
+	recordRequestMetrics(c.method, requestHost(url), c.upstream, statusCode, err, time.Since(start))
+
+	return resp, err
+}
+
+// defaultBalancers holds one round-robin Balancer per upstream name for
+// requests that don't call WithBalancer, so the rotation carries over from
+// one request to the next.
+var defaultBalancers sync.Map // upstream name -> Balancer
+
+func (c *client) pickEndpoint() (registry.Endpoint, error) {
+	cluster, err := resolveCluster(c.upstream)
+	if err != nil {
+		return registry.Endpoint{}, err
+	}
+	balancer := c.balancer
+	if balancer == nil {
+		v, _ := defaultBalancers.LoadOrStore(c.upstream, NewRoundRobinBalancer())
+		balancer = v.(Balancer)
+	}
+	return balancer.Pick(cluster.Endpoints)
+}
+
+func requestHost(rawurl string) string {
+	u, err := neturl.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	return u.Host
+}
+
 func (c *client) TLSClientConfig(conf *tls.Config) *client {
 	c.tlsClientConfig = conf
 	return c
@@ -157,7 +348,9 @@ func (c *client) ParseEmpty() error {
 	return c.ParseDataJson(nil)
 }
 
-func (c *client) ParseDataJson(data interface{}) error {
+func (c *client) ParseDataJson(data interface{}) (err error) {
+	defer recoverPanic(&err)
+
 	if c.err != nil {
 		return c.err
 	}
@@ -165,8 +358,13 @@ func (c *client) ParseDataJson(data interface{}) error {
 		_ = c.respBody.Body.Close()
 	}()
 
+	body, err := ioutil.ReadAll(c.respBody.Body)
+	if err != nil {
+		return err
+	}
+
 	if c.respBody.StatusCode != http.StatusOK {
-		return errors.New(c.respBody.Status)
+		return &HTTPStatusError{StatusCode: c.respBody.StatusCode, Status: c.respBody.Status, Body: body}
 	}
 
 	// 空解析
@@ -174,14 +372,15 @@ func (c *client) ParseDataJson(data interface{}) error {
 		return nil
 	}
 
-	body, err := ioutil.ReadAll(c.respBody.Body)
-	if err != nil {
-		return err
+	if err := jsoniter.Unmarshal(body, data); err != nil {
+		return &DecodeError{Err: err, Body: body}
 	}
-	return jsoniter.Unmarshal(body, data)
+	return nil
 }
 
-func (c *client) ParseString(str *string) error {
+func (c *client) ParseString(str *string) (err error) {
+	defer recoverPanic(&err)
+
 	if c.err != nil {
 		return c.err
 	}
@@ -189,15 +388,15 @@ func (c *client) ParseString(str *string) error {
 		_ = c.respBody.Body.Close()
 	}()
 
-	if c.respBody.StatusCode != http.StatusOK {
-		return errors.New(c.respBody.Status)
-	}
-
 	body, err := ioutil.ReadAll(c.respBody.Body)
 	if err != nil {
 		return err
 	}
 
+	if c.respBody.StatusCode != http.StatusOK {
+		return &HTTPStatusError{StatusCode: c.respBody.StatusCode, Status: c.respBody.Status, Body: body}
+	}
+
 	*str = string(body)
 	return nil
 }
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError wraps a panic recovered from the HTTP transport, JSON
+// unmarshalling, or a user-supplied io.Reader body, so that a single bad
+// response doesn't tear down the caller's goroutine.
+type PanicError struct {
+	Recovered interface{}
+	Stack     []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("client: recovered panic: %v", e.Recovered)
+}
+
+// TimeoutError wraps a transport-level timeout.
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("client: request timed out: %v", e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusError is returned when the server responds with a non-200
+// status. Unlike a plain errors.New(status), it carries the status code
+// and body so callers can react programmatically.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("client: unexpected status %s", e.Status)
+}
+
+// DecodeError wraps a failure to unmarshal a response body.
+type DecodeError struct {
+	Err  error
+	Body []byte
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("client: decode error: %v", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// recoverPanic recovers a panic on the calling goroutine and, if one
+// occurred, stores it as a *PanicError in target. It is meant to be
+// deferred directly: defer recoverPanic(&err).
+func recoverPanic(target *error) {
+	if r := recover(); r != nil {
+		*target = &PanicError{Recovered: r, Stack: debug.Stack()}
+	}
+}
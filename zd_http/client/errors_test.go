@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type panicReader struct{}
+
+func (panicReader) Read(p []byte) (int, error) {
+	panic("boom: panicReader always panics")
+}
+
+func TestWithBody_RecoversPanicFromReader(t *testing.T) {
+	c := NewReq(context.Background()).Post("http://example.invalid").WithBody(io.Reader(panicReader{}))
+
+	var panicErr *PanicError
+	if !errors.As(c.err, &panicErr) {
+		t.Fatalf("expected *PanicError, got %v (%T)", c.err, c.err)
+	}
+	if len(panicErr.Stack) == 0 {
+		t.Fatal("expected PanicError to capture a stack trace")
+	}
+}
+
+func TestParseDataJson_HTTPStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("unavailable"))
+	}))
+	defer srv.Close()
+
+	var out map[string]interface{}
+	err := NewReq(context.Background()).Get(srv.URL).Response().ParseDataJson(&out)
+
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected *HTTPStatusError, got %v (%T)", err, err)
+	}
+	if statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, statusErr.StatusCode)
+	}
+	if string(statusErr.Body) != "unavailable" {
+		t.Fatalf("expected body %q, got %q", "unavailable", statusErr.Body)
+	}
+}
+
+func TestParseDataJson_DecodeError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("not json"))
+	}))
+	defer srv.Close()
+
+	var out map[string]interface{}
+	err := NewReq(context.Background()).Get(srv.URL).Response().ParseDataJson(&out)
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected *DecodeError, got %v (%T)", err, err)
+	}
+	if string(decodeErr.Body) != "not json" {
+		t.Fatalf("expected body %q, got %q", "not json", decodeErr.Body)
+	}
+}
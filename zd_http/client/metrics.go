@@ -0,0 +1,35 @@
+package client
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/lfxnxf/emo-frame/metrics"
+)
+
+const (
+	metricRequestsTotal  = "http_client_requests_total"
+	metricErrorsTotal    = "http_client_errors_total"
+	metricRequestLatency = "http_client_request_latency_seconds"
+)
+
+// recordRequestMetrics emits the RED metrics for a single request/response
+// via metrics.Get(). It is a no-op until metrics.SetProvider is called.
+func recordRequestMetrics(method, host, upstream string, statusCode int, err error, elapsed time.Duration) {
+	provider := metrics.Get()
+	if provider == nil {
+		return
+	}
+
+	labels := map[string]string{
+		"method":   method,
+		"host":     host,
+		"upstream": upstream,
+		"status":   strconv.Itoa(statusCode),
+	}
+	provider.IncCounter(metricRequestsTotal, labels)
+	if err != nil {
+		provider.IncCounter(metricErrorsTotal, labels)
+	}
+	provider.ObserveLatency(metricRequestLatency, elapsed.Seconds(), labels)
+}
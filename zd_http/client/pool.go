@@ -0,0 +1,98 @@
+package client
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// PoolConfig tunes the transports built by clientFor. The zero value is
+// not used directly; DefaultPoolConfig is applied until Configure is
+// called.
+type PoolConfig struct {
+	// MaxIdleConns is the maximum number of idle connections kept across
+	// all hosts.
+	MaxIdleConns int
+	// MaxConnsPerHost caps the total (idle + active) connections per
+	// host. Zero means no limit.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept before being
+	// closed.
+	IdleConnTimeout time.Duration
+}
+
+// DefaultPoolConfig is used until Configure overrides it.
+var DefaultPoolConfig = PoolConfig{
+	MaxIdleConns:    100,
+	MaxConnsPerHost: 50,
+	IdleConnTimeout: 90 * time.Second,
+}
+
+var poolConfig = DefaultPoolConfig
+
+// Configure overrides the pool's transport knobs for every *http.Client
+// built afterwards. It does not affect clients already pooled; call
+// Close first if existing connections need to pick up the new settings.
+func Configure(cfg PoolConfig) {
+	poolConfig = cfg
+}
+
+// transportKey identifies a pooled *http.Client. tlsConfig is compared by
+// pointer, matching how callers pass it in via TLSClientConfig.
+type transportKey struct {
+	timeout   time.Duration
+	tlsConfig *tls.Config
+}
+
+var httpClients sync.Map // transportKey -> *http.Client
+
+// clientFor returns the pooled *http.Client for (timeout, tlsConfig),
+// building and caching one on first use. Reusing the client lets
+// keep-alives and HTTP/2 connections survive across calls instead of
+// every request paying for a fresh TCP (and TLS) handshake.
+func clientFor(timeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	key := transportKey{timeout: timeout, tlsConfig: tlsConfig}
+	if v, ok := httpClients.Load(key); ok {
+		return v.(*http.Client)
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: time.Second * 5,
+		}).DialContext,
+		MaxIdleConns:        poolConfig.MaxIdleConns,
+		MaxIdleConnsPerHost: poolConfig.MaxIdleConns,
+		MaxConnsPerHost:     poolConfig.MaxConnsPerHost,
+		IdleConnTimeout:     poolConfig.IdleConnTimeout,
+	}
+	// Falls back to HTTP/1.1 automatically when ALPN doesn't negotiate h2.
+	// ConfigureTransport only fails when the transport is already set up
+	// for HTTP/2, which a freshly built one is not, so the error is ignored.
+	_ = http2.ConfigureTransport(transport)
+
+	httpClient := &http.Client{Transport: transport, Timeout: timeout}
+	actual, loaded := httpClients.LoadOrStore(key, httpClient)
+	if loaded {
+		return actual.(*http.Client)
+	}
+	return httpClient
+}
+
+// Close drains idle connections from every pooled transport and forgets
+// the clients, so a subsequent Configure takes full effect and no
+// keep-alive sockets are left open. Call it on shutdown.
+func Close() {
+	httpClients.Range(func(key, value interface{}) bool {
+		if transport, ok := value.(*http.Client).Transport.(*http.Transport); ok {
+			transport.CloseIdleConnections()
+		}
+		httpClients.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryConfig controls WithRetry/WithRetryConfig's backoff behaviour.
+type RetryConfig struct {
+	// MaxRetries is the number of additional attempts after the first.
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry; it doubles on
+	// every subsequent attempt before full jitter is applied on top.
+	BaseDelay time.Duration
+	// MaxDelay caps the computed backoff.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryConfig is the backoff used by WithRetry.
+var DefaultRetryConfig = RetryConfig{
+	BaseDelay: 50 * time.Millisecond,
+	MaxDelay:  2 * time.Second,
+}
+
+// retryBackoff returns a full-jitter delay for the given zero-based
+// attempt: a uniformly random duration between 0 and the exponentially
+// grown, capped base delay.
+func retryBackoff(cfg RetryConfig, attempt int) time.Duration {
+	delay := cfg.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > cfg.MaxDelay {
+		delay = cfg.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// isRetryable reports whether method may be retried without an explicit
+// WithIdempotent override: GET, HEAD and OPTIONS never mutate state.
+func isRetryable(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/lfxnxf/emo-frame/zd_http/client"
+
+// startSpan starts a client-kind span around a single HTTP round-trip.
+func startSpan(ctx context.Context, method, url string) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, method+" "+url, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(
+		attribute.String("http.method", method),
+		attribute.String("http.url", url),
+	)
+	return ctx, span
+}
+
+// injectTraceContext writes W3C traceparent/tracestate headers for ctx
+// into header so the downstream service can continue the trace.
+func injectTraceContext(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lfxnxf/emo-frame/tpc/inf/go-upstream/registry"
+)
+
+// Resolver resolves an upstream name to its current cluster list. It is
+// typically backed by a cache kept up to date from a registry.Backend's
+// Watch channel.
+type Resolver interface {
+	Resolve(name string) ([]*registry.Cluster, error)
+}
+
+var resolver Resolver
+
+// SetUpstreamResolver wires r as the Resolver used by Upstream. It is
+// expected to be called once at startup.
+func SetUpstreamResolver(r Resolver) {
+	resolver = r
+}
+
+// ErrNoResolver is the error Response fails with for a request built with
+// Upstream before SetUpstreamResolver has been called.
+var ErrNoResolver = errors.New("client: no upstream resolver configured, call client.SetUpstreamResolver first")
+
+func resolveCluster(name string) (*registry.Cluster, error) {
+	if resolver == nil {
+		return nil, ErrNoResolver
+	}
+	clusters, err := resolver.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, cl := range clusters {
+		if cl.Name == name {
+			return cl, nil
+		}
+	}
+	return nil, fmt.Errorf("client: upstream %q not found", name)
+}